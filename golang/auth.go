@@ -0,0 +1,120 @@
+package main
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"whisperapi/auth"
+)
+
+// Глобальные объекты аутентификации: хранилище ключей и ограничитель частоты/квот
+var (
+	keyStore    auth.KeyStore
+	rateLimiter *auth.RateLimiter
+	authn       *auth.Authenticator
+)
+
+// initAuth поднимает хранилище API ключей (пока только из переменной окружения
+// WHISPER_API_KEYS) и ограничитель частоты запросов/аудио-квот
+func initAuth() {
+	store := auth.NewMemoryKeyStore()
+	if err := auth.ParseEnvKeys(store, getEnv("WHISPER_API_KEYS", "")); err != nil {
+		log.Fatalf("не удалось разобрать WHISPER_API_KEYS: %v", err)
+	}
+
+	keyStore = store
+	rateLimiter = auth.NewRateLimiter()
+	authn = auth.NewAuthenticator(keyStore, rateLimiter)
+}
+
+// chargeAudioQuota резервирует использованные аудио-минуты за ключом запроса после
+// завершения транскрипции. Длительность аудио неизвестна до ответа Whisper, поэтому
+// квота по аудио-минутам проверяется постфактум, а не перед отправкой запроса (в
+// отличие от лимита запросов в минуту, который проверяется в auth.Middleware).
+func chargeAudioQuota(c *gin.Context, audioSeconds float64) {
+	principal, ok := auth.FromContext(c)
+	if !ok {
+		return
+	}
+	chargeAudioQuotaForKey(apiKeyFromContext(c), principal.Quotas, audioSeconds)
+}
+
+// chargeAudioQuotaForKey - то же самое, что chargeAudioQuota, но для вызовов без
+// gin.Context: задача job-очереди завершается уже после того, как исходный HTTP-запрос
+// вернул ответ, поэтому ключ и квоты нужно передавать явно.
+func chargeAudioQuotaForKey(key string, quotas auth.Quotas, audioSeconds float64) {
+	if key == "" {
+		return
+	}
+	if err := rateLimiter.ReserveAudio(key, quotas, audioSeconds/60.0); err != nil {
+		log.Printf("ключ %s превысил суточную квоту аудио-минут: %v", key, err)
+	}
+}
+
+// apiKeyFromContext достаёт сырой API ключ из заголовка запроса - нужен отдельно от
+// Principal, так как RateLimiter ведёт учёт по самому ключу, а не по ID владельца
+func apiKeyFromContext(c *gin.Context) string {
+	const prefix = "Bearer "
+	header := c.GetHeader("Authorization")
+	if len(header) > len(prefix) {
+		return header[len(prefix):]
+	}
+	return ""
+}
+
+// createKeyRequest - тело запроса POST /admin/keys
+type createKeyRequest struct {
+	Key    string      `json:"key" binding:"required"`
+	ID     string      `json:"id" binding:"required"`
+	Tier   string      `json:"tier"`
+	Quotas auth.Quotas `json:"quotas"`
+}
+
+// createKeyHandler регистрирует новый API ключ; защищён AdminMiddleware
+func createKeyHandler(c *gin.Context) {
+	var req createKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "некорректное тело запроса: " + err.Error()})
+		return
+	}
+
+	principal := auth.Principal{ID: req.ID, Tier: auth.Tier(req.Tier), Quotas: req.Quotas}
+	if err := keyStore.Create(c.Request.Context(), req.Key, principal); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, principal)
+}
+
+// keyUsageHandler возвращает текущий суточный расход ключа по его ID; защищён
+// AdminMiddleware. Поскольку RateLimiter ведёт учёт по самому ключу, а не по ID,
+// обработчик принимает сырой ключ в query-параметре key.
+func keyUsageHandler(c *gin.Context) {
+	key := c.Query("key")
+	if key == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "не передан параметр key"})
+		return
+	}
+
+	principal, found, err := keyStore.Lookup(c.Request.Context(), key)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !found || principal.ID != c.Param("id") {
+		c.JSON(http.StatusNotFound, gin.H{"error": "ключ не найден"})
+		return
+	}
+
+	requestCount, audioMinutes := rateLimiter.Usage(key)
+	c.JSON(http.StatusOK, gin.H{
+		"id":                  principal.ID,
+		"tier":                principal.Tier,
+		"quotas":              principal.Quotas,
+		"requests_today":      requestCount,
+		"audio_minutes_today": audioMinutes,
+	})
+}
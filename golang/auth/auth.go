@@ -0,0 +1,31 @@
+// Package auth реализует проверку API ключей, квоты и ограничение частоты запросов
+// для эндпоинтов, которые раньше были полностью открытыми.
+package auth
+
+import (
+	"context"
+)
+
+// Tier - тарифный план ключа, определяет квоты по умолчанию
+type Tier string
+
+// Quotas - ограничения, действующие для конкретного ключа
+type Quotas struct {
+	RequestsPerMinute  int     `json:"requests_per_minute"`
+	AudioMinutesPerDay float64 `json:"audio_minutes_per_day"`
+}
+
+// Principal - владелец API ключа, к которому привязан запрос
+type Principal struct {
+	ID     string `json:"id"`
+	Tier   Tier   `json:"tier"`
+	Quotas Quotas `json:"quotas"`
+}
+
+// KeyStore - источник истины о том, какие API ключи существуют и кому принадлежат
+type KeyStore interface {
+	// Lookup возвращает Principal для ключа, если он существует и не отозван
+	Lookup(ctx context.Context, key string) (Principal, bool, error)
+	// Create регистрирует новый ключ с заданным Principal
+	Create(ctx context.Context, key string, principal Principal) error
+}
@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// principalContextKey - ключ, под которым Principal кладётся в gin.Context
+const principalContextKey = "auth.principal"
+
+// Authenticator связывает хранилище ключей и ограничитель частоты запросов,
+// необходимые middleware для проверки каждого запроса
+type Authenticator struct {
+	Store   KeyStore
+	Limiter *RateLimiter
+}
+
+// NewAuthenticator создаёт Authenticator поверх переданных store и limiter
+func NewAuthenticator(store KeyStore, limiter *RateLimiter) *Authenticator {
+	return &Authenticator{Store: store, Limiter: limiter}
+}
+
+// Middleware проверяет заголовок "Authorization: Bearer <key>", ограничивает частоту
+// запросов по квоте ключа и кладёт Principal в контекст. Проверку аудио-минут
+// выполняют сами обработчики через ReserveAudio, так как длительность файла на этом
+// этапе ещё неизвестна.
+func (a *Authenticator) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key, ok := bearerToken(c.GetHeader("Authorization"))
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "отсутствует или некорректен заголовок Authorization"})
+			return
+		}
+
+		principal, found, err := a.Store.Lookup(c.Request.Context(), key)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "ошибка проверки API ключа: " + err.Error()})
+			return
+		}
+		if !found {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "неизвестный API ключ"})
+			return
+		}
+
+		if !a.Limiter.Allow(key, principal.Quotas) {
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "превышен лимит запросов в минуту"})
+			return
+		}
+
+		c.Set(principalContextKey, principal)
+		c.Next()
+	}
+}
+
+// AdminMiddleware проверяет отдельный административный токен (WHISPER_ADMIN_TOKEN),
+// не связанный с обычными API ключами, и защищает группу /admin
+func AdminMiddleware(adminToken string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, ok := bearerToken(c.GetHeader("Authorization"))
+		if !ok || adminToken == "" || token != adminToken {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "недействительный административный токен"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// FromContext возвращает Principal текущего запроса, если Middleware уже отработал
+func FromContext(c *gin.Context) (Principal, bool) {
+	value, ok := c.Get(principalContextKey)
+	if !ok {
+		return Principal{}, false
+	}
+	principal, ok := value.(Principal)
+	return principal, ok
+}
+
+func bearerToken(header string) (string, bool) {
+	const prefix = "Bearer "
+	if !strings.HasPrefix(header, prefix) {
+		return "", false
+	}
+	token := strings.TrimSpace(strings.TrimPrefix(header, prefix))
+	if token == "" {
+		return "", false
+	}
+	return token, true
+}
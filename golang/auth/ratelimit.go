@@ -0,0 +1,123 @@
+package auth
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// usage - суточный расход ключа, нужен и для квоты по аудио-минутам, и для
+// эндпоинта /admin/keys/:id/usage
+type usage struct {
+	day          string
+	requestCount int64
+	audioMinutes float64
+}
+
+// keyLimiter - состояние ограничения для одного ключа: токен-бакет на запросы в
+// минуту плюс счётчик аудио-минут за текущие сутки
+type keyLimiter struct {
+	requests *rate.Limiter
+	quotas   Quotas
+
+	mu    sync.Mutex
+	usage usage
+}
+
+// RateLimiter ограничивает частоту запросов на ключ и ведёт учёт суточного расхода
+// аудио-минут. Запросы по аудио-квоте он не отклоняет: ReserveAudio лишь возвращает
+// ошибку и не учитывает минуты, которые вывели бы расход за AudioMinutesPerDay.
+type RateLimiter struct {
+	mu       sync.Mutex
+	limiters map[string]*keyLimiter
+}
+
+// NewRateLimiter создаёт пустой RateLimiter; лимитеры заводятся лениво по мере
+// появления новых ключей
+func NewRateLimiter() *RateLimiter {
+	return &RateLimiter{limiters: make(map[string]*keyLimiter)}
+}
+
+func (r *RateLimiter) forKey(key string, quotas Quotas) *keyLimiter {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	kl, ok := r.limiters[key]
+	if !ok || kl.quotas != quotas {
+		rpm := quotas.RequestsPerMinute
+		if rpm <= 0 {
+			rpm = 1
+		}
+		kl = &keyLimiter{
+			requests: rate.NewLimiter(rate.Limit(float64(rpm)/60.0), rpm),
+			quotas:   quotas,
+		}
+		r.limiters[key] = kl
+	}
+	return kl
+}
+
+// Allow проверяет лимит запросов в минуту для ключа и, если запрос пропущен, учитывает
+// его в суточном requestCount - это происходит на каждом защищённом запросе независимо
+// от эндпоинта, поэтому requestCount отражает реальное число запросов, а не только
+// синхронные транскрипции, резервирующие аудио-квоту через ReserveAudio. Сама проверка
+// не потребляет аудио-минуты - для этого используется ReserveAudio после того, как
+// известна длительность файла.
+func (r *RateLimiter) Allow(key string, quotas Quotas) bool {
+	kl := r.forKey(key, quotas)
+	if !kl.requests.Allow() {
+		return false
+	}
+
+	kl.mu.Lock()
+	today := time.Now().UTC().Format("2006-01-02")
+	if kl.usage.day != today {
+		kl.usage = usage{day: today}
+	}
+	kl.usage.requestCount++
+	kl.mu.Unlock()
+
+	return true
+}
+
+// ReserveAudio проверяет и резервирует audioMinutes из суточной квоты ключа.
+// Возвращает ошибку, если резервирование превысило бы AudioMinutesPerDay.
+func (r *RateLimiter) ReserveAudio(key string, quotas Quotas, audioMinutes float64) error {
+	kl := r.forKey(key, quotas)
+
+	kl.mu.Lock()
+	defer kl.mu.Unlock()
+
+	today := time.Now().UTC().Format("2006-01-02")
+	if kl.usage.day != today {
+		kl.usage = usage{day: today}
+	}
+
+	if quotas.AudioMinutesPerDay > 0 && kl.usage.audioMinutes+audioMinutes > quotas.AudioMinutesPerDay {
+		return fmt.Errorf("превышена суточная квота аудио-минут: %.1f из %.1f", kl.usage.audioMinutes, quotas.AudioMinutesPerDay)
+	}
+
+	kl.usage.audioMinutes += audioMinutes
+	return nil
+}
+
+// Usage возвращает текущий суточный расход ключа для админ-эндпоинта
+func (r *RateLimiter) Usage(key string) (requestCount int64, audioMinutes float64) {
+	r.mu.Lock()
+	kl, ok := r.limiters[key]
+	r.mu.Unlock()
+	if !ok {
+		return 0, 0
+	}
+
+	kl.mu.Lock()
+	defer kl.mu.Unlock()
+
+	today := time.Now().UTC().Format("2006-01-02")
+	if kl.usage.day != today {
+		return 0, 0
+	}
+	return kl.usage.requestCount, kl.usage.audioMinutes
+}
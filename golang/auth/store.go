@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrKeyExists возвращается Create, если ключ уже зарегистрирован
+var ErrKeyExists = errors.New("ключ уже существует")
+
+// MemoryKeyStore - потокобезопасное хранилище ключей в памяти процесса; ключи попадают
+// в него из переменной окружения (ParseEnvKeys) и через Create. Это единственная
+// реализация KeyStore в пакете.
+type MemoryKeyStore struct {
+	mu   sync.RWMutex
+	keys map[string]Principal
+}
+
+// NewMemoryKeyStore создаёт пустое хранилище ключей
+func NewMemoryKeyStore() *MemoryKeyStore {
+	return &MemoryKeyStore{keys: make(map[string]Principal)}
+}
+
+func (s *MemoryKeyStore) Lookup(ctx context.Context, key string) (Principal, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	p, ok := s.keys[key]
+	return p, ok, nil
+}
+
+func (s *MemoryKeyStore) Create(ctx context.Context, key string, principal Principal) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.keys[key]; exists {
+		return ErrKeyExists
+	}
+	s.keys[key] = principal
+	return nil
+}
+
+// ParseEnvKeys разбирает WHISPER_API_KEYS вида
+// "key1:id1:tier1:rpm1:audiomin1,key2:id2:tier2:rpm2:audiomin2" и заполняет store.
+// Формат выбран по аналогии с другими списковыми переменными окружения в проекте
+// (через запятую, с ":" в качестве разделителя полей записи).
+func ParseEnvKeys(store *MemoryKeyStore, raw string) error {
+	if raw == "" {
+		return nil
+	}
+
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		fields := strings.Split(entry, ":")
+		if len(fields) != 5 {
+			return fmt.Errorf("некорректная запись в WHISPER_API_KEYS: %q (ожидается key:id:tier:rpm:audiomin)", entry)
+		}
+
+		key, id, tier := fields[0], fields[1], fields[2]
+
+		rpm, err := strconv.Atoi(fields[3])
+		if err != nil {
+			return fmt.Errorf("некорректный requests_per_minute в записи %q: %v", entry, err)
+		}
+
+		audioMinutes, err := strconv.ParseFloat(fields[4], 64)
+		if err != nil {
+			return fmt.Errorf("некорректный audio_minutes_per_day в записи %q: %v", entry, err)
+		}
+
+		principal := Principal{
+			ID:   id,
+			Tier: Tier(tier),
+			Quotas: Quotas{
+				RequestsPerMinute:  rpm,
+				AudioMinutesPerDay: audioMinutes,
+			},
+		}
+
+		if err := store.Create(context.Background(), key, principal); err != nil {
+			return fmt.Errorf("не удалось зарегистрировать ключ из WHISPER_API_KEYS: %v", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"whisperapi/auth"
+	"whisperapi/queue"
+)
+
+// Глобальная очередь задач транскрипции
+var jobQueue *queue.Queue
+
+// initJobQueue открывает персистентное хранилище задач и поднимает пул воркеров,
+// размер которого задаётся через WHISPER_WORKERS (по умолчанию 2)
+func initJobQueue() {
+	store, err := queue.NewBuntStore(getEnv("WHISPER_JOBS_DB", "./whisper-jobs.db"))
+	if err != nil {
+		log.Fatalf("не удалось открыть хранилище задач: %v", err)
+	}
+
+	workers := 2
+	if raw := getEnv("WHISPER_WORKERS", ""); raw != "" {
+		if n, err := strconv.Atoi(raw); err == nil && n > 0 {
+			workers = n
+		}
+	}
+
+	jobQueue = queue.New(store, runTranscriptionJob, workers)
+	go reportQueueDepth()
+}
+
+// reportQueueDepth периодически публикует глубину очереди в whisper_queue_depth
+func reportQueueDepth() {
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+	for range ticker.C {
+		queueDepthGauge.Set(float64(jobQueue.PendingCount()))
+	}
+}
+
+// runTranscriptionJob - queue.Handler, транскрибирующий загруженный файл задачи и
+// удаляющий временный файл или объект в хранилище после завершения
+func runTranscriptionJob(ctx context.Context, job queue.Job, onProgress func(float64)) (json.RawMessage, error) {
+	if job.InputPath != "" {
+		defer os.Remove(job.InputPath)
+	}
+	if job.AudioRef != "" {
+		defer storageBackend.Delete(context.Background(), job.AudioRef)
+	}
+
+	var language *string
+	if job.Language != "" {
+		language = &job.Language
+	}
+
+	var audioBytes int
+	if job.InputPath != "" {
+		if info, err := os.Stat(job.InputPath); err == nil {
+			audioBytes = int(info.Size())
+		}
+	}
+
+	requestStart := time.Now()
+	var result *TranscriptionResponse
+	var err error
+	if job.AudioRef != "" {
+		result, err = whisperClient.TranscribeRefWithProgress(ctx, job.AudioRef, job.Model, language, job.Task, onProgress)
+	} else {
+		result, err = whisperClient.TranscribeWithProgress(ctx, job.InputPath, job.Model, language, job.Task, onProgress)
+	}
+
+	status := "success"
+	if err != nil {
+		status = "error"
+	}
+	recordTranscription(job.Model, job.Task, job.Language, status, time.Since(requestStart), audioBytes)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Списываем аудио-минуты с суточной квоты ключа, поставившего задачу, - как и в
+	// transcribeHandler, оцениваем длительность по последнему сегменту результата
+	if n := len(result.Segments); n > 0 {
+		chargeAudioQuotaForKey(job.APIKey, job.Quotas, result.Segments[n-1].End)
+	}
+
+	return json.Marshal(result)
+}
+
+// createJobHandler принимает либо загруженный файл, либо upload_id завершённой TUS
+// загрузки (чтобы не загружать файл повторно после её резюмирования), и сразу
+// возвращает 202 с ID задачи, не дожидаясь окончания транскрипции
+func createJobHandler(c *gin.Context) {
+	var inputPath, audioRef string
+
+	if uploadID := c.PostForm("upload_id"); uploadID != "" {
+		ref, isLocal, err := resolveTusUploadPath(uploadID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if isLocal {
+			inputPath = ref
+		} else {
+			audioRef = ref
+		}
+	} else {
+		file, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Ошибка при получении файла: " + err.Error()})
+			return
+		}
+
+		// Сохраняем через storageBackend, а не напрямую на диск процесса API - это то, что
+		// позволяет S3/GCS бэкендам хранилища работать и для job-очереди, как уже работает
+		// transcribeHandler
+		src, err := file.Open()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при открытии загруженного файла: " + err.Error()})
+			return
+		}
+		defer src.Close()
+
+		ref, err := storageBackend.Put(c.Request.Context(), src)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при сохранении файла в хранилище: " + err.Error()})
+			return
+		}
+		audioRef = ref
+	}
+
+	job := queue.Job{
+		Model:     c.DefaultPostForm("model", "base"),
+		Language:  c.PostForm("language"),
+		Task:      c.DefaultPostForm("task", "transcribe"),
+		InputPath: inputPath,
+		AudioRef:  audioRef,
+	}
+	if principal, ok := auth.FromContext(c); ok {
+		job.APIKey = apiKeyFromContext(c)
+		job.Quotas = principal.Quotas
+		job.Owner = principal.ID
+	}
+
+	created, err := jobQueue.Enqueue(job)
+	if err != nil {
+		if inputPath != "" {
+			os.Remove(inputPath)
+		}
+		if audioRef != "" {
+			storageBackend.Delete(context.Background(), audioRef)
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при постановке задачи в очередь: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, created.Redacted())
+}
+
+// jobOwnedByCaller проверяет, что задача принадлежит принципалу текущего запроса. ID
+// задачи (queue.newID) предсказуем (job-<unixnano>), поэтому без этой проверки любой
+// валидный ключ мог бы читать или отменять чужие задачи.
+func jobOwnedByCaller(c *gin.Context, job queue.Job) bool {
+	principal, ok := auth.FromContext(c)
+	return ok && principal.ID == job.Owner
+}
+
+// getJobHandler возвращает текущее состояние задачи по ID
+func getJobHandler(c *gin.Context) {
+	job, ok := jobQueue.Get(c.Param("id"))
+	if !ok || !jobOwnedByCaller(c, job) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "задача не найдена"})
+		return
+	}
+	c.JSON(http.StatusOK, job.Redacted())
+}
+
+// jobEventsHandler транслирует обновления задачи через Server-Sent Events до тех пор,
+// пока задача не перейдёт в терминальный статус или клиент не отключится
+func jobEventsHandler(c *gin.Context) {
+	id := c.Param("id")
+	job, ok := jobQueue.Get(id)
+	if !ok || !jobOwnedByCaller(c, job) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "задача не найдена"})
+		return
+	}
+
+	events, cancel := jobQueue.Subscribe(id)
+	defer cancel()
+
+	// Задача могла завершиться до подписки - новых событий тогда не будет, поэтому
+	// итоговое состояние отдаётся сразу
+	if current, ok := jobQueue.Get(id); ok && current.Status != queue.StatusQueued && current.Status != queue.StatusRunning {
+		c.SSEvent("job", current.Redacted())
+		return
+	}
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case job, ok := <-events:
+			if !ok {
+				return false
+			}
+			c.SSEvent("job", job.Redacted())
+			return job.Status == queue.StatusQueued || job.Status == queue.StatusRunning
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
+
+// deleteJobHandler отменяет ещё не завершённую задачу
+func deleteJobHandler(c *gin.Context) {
+	job, ok := jobQueue.Get(c.Param("id"))
+	if !ok || !jobOwnedByCaller(c, job) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "задача не найдена"})
+		return
+	}
+	if err := jobQueue.Cancel(job.ID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -1,15 +1,21 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/rs/zerolog"
+	"github.com/tus/tusd/v2/pkg/handler"
+
+	"whisperapi/auth"
+	"whisperapi/storage"
 )
 
 var (
@@ -19,11 +25,25 @@ var (
 	serverPort  = getEnv("SERVER_PORT", "8080")
 	// Режим работы (debug/release)
 	ginMode = getEnv("GIN_MODE", "debug")
+	// Административный токен для /admin, отдельный от обычных API ключей
+	adminToken = getEnv("WHISPER_ADMIN_TOKEN", "")
+
+	// corsAllowedOrigins - список источников, которым разрешены запросы с credentials.
+	// Раньше здесь был "*" вместе с AllowCredentials: true, что является нарушением
+	// спецификации CORS (браузеры его просто игнорируют) и на практике открывало API
+	// любому сайту. Теперь источники задаются явно через WHISPER_CORS_ORIGINS.
+	corsAllowedOrigins = strings.Split(getEnv("WHISPER_CORS_ORIGINS", "http://localhost:3000"), ",")
 )
 
 // Глобальный клиент Whisper
 var whisperClient *WhisperClient
 
+// Хранилище загруженных аудиофайлов (local, s3 или gcs — см. STORAGE_BACKEND)
+var storageBackend storage.Backend
+
+// Обработчик резюмируемых TUS загрузок, смонтированный на /api/uploads
+var tusHandler *handler.Handler
+
 // Вспомогательная функция для получения переменных окружения с значениями по умолчанию
 func getEnv(key, defaultValue string) string {
 	value := os.Getenv(key)
@@ -40,6 +60,26 @@ func init() {
 
 	// Инициализируем клиент для связи с сервисом Whisper
 	whisperClient = NewWhisperClient(whisperHost, whisperPort)
+
+	// Поднимаем хранилище загруженных файлов
+	backend, err := newStorageBackend()
+	if err != nil {
+		log.Fatalf("не удалось инициализировать хранилище: %v", err)
+	}
+	storageBackend = backend
+
+	// Поднимаем обработчик резюмируемых TUS загрузок для больших файлов
+	th, err := newTusHandler()
+	if err != nil {
+		log.Fatalf("не удалось инициализировать TUS загрузки: %v", err)
+	}
+	tusHandler = th
+
+	// Поднимаем очередь фоновых задач транскрипции
+	initJobQueue()
+
+	// Поднимаем аутентификацию по API ключам и ограничитель частоты/квот
+	initAuth()
 }
 
 // Основная функция веб-сервера
@@ -54,8 +94,8 @@ func main() {
 	// Middleware
 	router.Use(gin.Recovery())
 	router.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{"*"},
-		AllowMethods:     []string{"GET", "POST", "OPTIONS"},
+		AllowOrigins:     corsAllowedOrigins,
+		AllowMethods:     []string{"GET", "POST", "OPTIONS", "DELETE"},
 		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
 		ExposeHeaders:    []string{"Content-Length"},
 		AllowCredentials: true,
@@ -85,16 +125,46 @@ func main() {
 		// Получение списка моделей
 		api.GET("/models", getModelsHandler)
 
-		// Транскрипция аудиофайла
-		api.POST("/transcribe", transcribeHandler)
-
-		// Информация о статусе сервера
+		// Информация о статусе сервера - сознательно без аутентификации, чтобы
+		// балансировщики и оркестраторы могли опрашивать её без API ключа
 		api.GET("/health", healthCheckHandler)
 
-		// Метрики сервиса
-		api.GET("/metrics", metricsHandler)
+		// JSON-сводка метрик для обратной совместимости, сами метрики теперь на /metrics
+		api.GET("/metrics", legacyMetricsHandler)
+
+		// Эндпоинты, расходующие квоту ключа: транскрипция, фоновые задачи, стриминг
+		protected := api.Group("")
+		protected.Use(authn.Middleware())
+		{
+			// Транскрипция аудиофайла
+			protected.POST("/transcribe", transcribeHandler)
+
+			// Потоковая транскрипция по WebSocket с промежуточными результатами
+			protected.GET("/stream", streamHandler)
+
+			// Асинхронные задачи транскрипции: поставить в очередь, опросить, подписаться, отменить
+			protected.POST("/jobs", createJobHandler)
+			protected.GET("/jobs/:id", getJobHandler)
+			protected.GET("/jobs/:id/events", jobEventsHandler)
+			protected.DELETE("/jobs/:id", deleteJobHandler)
+		}
+	}
+
+	// Административные эндпоинты управления ключами, защищены отдельным токеном
+	// WHISPER_ADMIN_TOKEN, не связанным с обычными API ключами
+	admin := router.Group("/admin")
+	admin.Use(auth.AdminMiddleware(adminToken))
+	{
+		admin.POST("/keys", createKeyHandler)
+		admin.GET("/keys/:id/usage", keyUsageHandler)
 	}
 
+	// Метрики сервиса в формате Prometheus
+	router.GET("/metrics", metricsHandler)
+
+	// Резюмируемые TUS загрузки больших файлов
+	registerTusRoutes(router, tusHandler)
+
 	// Статические файлы для веб-интерфейса
 	router.Static("/static", "./static")
 	router.StaticFile("/", "./static/index.html")
@@ -130,17 +200,6 @@ func getModelsHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, models)
 }
 
-// Обработчик для метрик сервиса
-func metricsHandler(c *gin.Context) {
-	metrics := whisperClient.GetMetrics()
-	c.JSON(http.StatusOK, gin.H{
-		"requests_total":     metrics.RequestsTotal,
-		"errors_total":       metrics.ErrorsTotal,
-		"processing_time_ms": metrics.ProcessingTimeMs,
-		"uptime":             time.Since(startTime).String(),
-	})
-}
-
 // Обработчик для транскрипции аудио
 func transcribeHandler(c *gin.Context) {
 	// Обработка файла
@@ -156,20 +215,26 @@ func transcribeHandler(c *gin.Context) {
 		return
 	}
 
-	// Создаем временный файл
-	tempFile, err := os.CreateTemp("", "whisper-upload-*.tmp")
+	// Открываем загруженный файл и стримим его прямо в хранилище, без обязательного
+	// временного файла на диске процесса API — это то, что позволяет S3/GCS бэкендам
+	// работать, когда API и Whisper воркеры живут на разных хостах
+	src, err := file.Open()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при создании временного файла: " + err.Error()})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при открытии загруженного файла: " + err.Error()})
 		return
 	}
-	defer os.Remove(tempFile.Name())
-	defer tempFile.Close()
+	defer src.Close()
 
-	// Сохраняем загруженный файл
-	if err := c.SaveUploadedFile(file, tempFile.Name()); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при сохранении файла: " + err.Error()})
+	ref, err := storageBackend.Put(c.Request.Context(), src)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при сохранении файла в хранилище: " + err.Error()})
 		return
 	}
+	defer func() {
+		if err := storageBackend.Delete(context.Background(), ref); err != nil {
+			log.Printf("не удалось удалить загруженный файл %s из хранилища: %v", ref, err)
+		}
+	}()
 
 	log.Printf("Начало обработки файла %s (%.2f МБ)", file.Filename, float64(file.Size)/1024/1024)
 
@@ -182,9 +247,19 @@ func transcribeHandler(c *gin.Context) {
 	task := c.DefaultPostForm("task", "transcribe")
 
 	// Выполняем транскрипцию
-	startTime := time.Now()
-	result, err := whisperClient.Transcribe(tempFile.Name(), model, language, task)
-	elapsedTime := time.Since(startTime)
+	requestStart := time.Now()
+	result, err := whisperClient.TranscribeRef(ref, model, language, task)
+	elapsedTime := time.Since(requestStart)
+
+	status := "success"
+	if err != nil {
+		status = "error"
+	}
+	languageLabel := ""
+	if language != nil {
+		languageLabel = *language
+	}
+	recordTranscription(model, task, languageLabel, status, elapsedTime, int(file.Size))
 
 	// Проверяем ошибки
 	if err != nil {
@@ -194,6 +269,12 @@ func transcribeHandler(c *gin.Context) {
 		return
 	}
 
+	// Списываем аудио-минуты с суточной квоты ключа по длительности последнего
+	// сегмента - это единственная оценка длительности, доступная после транскрипции
+	if n := len(result.Segments); n > 0 {
+		chargeAudioQuota(c, result.Segments[n-1].End)
+	}
+
 	// Возвращаем результат с дополнительной информацией о времени обработки
 	c.JSON(http.StatusOK, gin.H{
 		"status": "success",
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// registry - выделенный реестр метрик, не смешанный со стандартными метриками рантайма Go,
+// чтобы /metrics отдавал только то, что относится к самому Whisper API
+var registry = prometheus.NewRegistry()
+
+var (
+	requestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "whisper_requests_total",
+		Help: "Общее количество запросов транскрипции по модели, задаче, языку и статусу",
+	}, []string{"model", "task", "language", "status"})
+
+	processingSecondsHistogram = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "whisper_processing_seconds",
+		Help:    "Время обработки запроса транскрипции в секундах",
+		Buckets: []float64{0.5, 1, 2, 5, 10, 30, 60, 120, 300, 600, 900, 1800},
+	}, []string{"model", "task"})
+
+	audioBytesTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "whisper_audio_bytes_total",
+		Help: "Суммарный объём полученных на транскрипцию аудиоданных в байтах",
+	})
+
+	activeStreamsGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "whisper_active_streams",
+		Help: "Текущее количество открытых соединений /api/stream",
+	})
+
+	tcpReconnectsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "whisper_tcp_reconnects_total",
+		Help: "Сколько раз пул соединений открывал новое TCP соединение к Whisper сервису, включая первое подключение каждого слота",
+	})
+
+	queueDepthGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "whisper_queue_depth",
+		Help: "Количество задач транскрипции, ожидающих выполнения в очереди",
+	})
+)
+
+func init() {
+	registry.MustRegister(
+		requestsTotal,
+		processingSecondsHistogram,
+		audioBytesTotal,
+		activeStreamsGauge,
+		tcpReconnectsTotal,
+		queueDepthGauge,
+	)
+}
+
+// recordTranscription фиксирует завершённый запрос транскрипции в Prometheus метриках
+func recordTranscription(model, task, language, status string, duration time.Duration, audioBytes int) {
+	if language == "" {
+		language = "auto"
+	}
+	requestsTotal.WithLabelValues(model, task, language, status).Inc()
+	processingSecondsHistogram.WithLabelValues(model, task).Observe(duration.Seconds())
+	if audioBytes > 0 {
+		audioBytesTotal.Add(float64(audioBytes))
+	}
+}
+
+// metricsHandler отдаёт метрики в стандартном текстовом формате Prometheus на /metrics
+func metricsHandler(c *gin.Context) {
+	promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(c.Writer, c.Request)
+}
+
+// legacyMetricsHandler сохраняет прежний JSON-формат сводки метрик на /api/metrics
+// для обратной совместимости с клиентами, написанными до перехода на Prometheus
+func legacyMetricsHandler(c *gin.Context) {
+	metrics := whisperClient.GetMetrics()
+	c.JSON(200, gin.H{
+		"requests_total":     metrics.RequestsTotal,
+		"errors_total":       metrics.ErrorsTotal,
+		"processing_time_ms": metrics.ProcessingTimeMs,
+		"active_streams":     metrics.ActiveStreams,
+		"dropped_windows":    metrics.DroppedWindows,
+		"uptime":             time.Since(startTime).String(),
+	})
+}
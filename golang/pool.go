@@ -0,0 +1,281 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// requestHeaderSize - заголовок мультиплексированного кадра [id:8][len:8]. ID запроса
+// позволяет одному TCP соединению обслуживать несколько запросов параллельно, так что
+// долгая транскрипция больше не блокирует ListModels и /metrics на том же сокете.
+const requestHeaderSize = 16
+
+// poolIdleTimeout - соединение без ожидающих ответа запросов, простаивающее дольше этого,
+// закрывается health checker'ом; новое на его место открывает get() при следующем запросе
+const poolIdleTimeout = 5 * time.Minute
+
+// poolHealthCheckInterval - как часто пул проверяет живость и простой своих соединений
+const poolHealthCheckInterval = 30 * time.Second
+
+// pendingCall - вызов, ожидающий ответа с конкретным ID
+type pendingCall struct {
+	response chan []byte
+	errCh    chan error
+}
+
+// pooledConn - одно TCP соединение с диспетчером, читающим кадры и раздающим их
+// вызывающим по ID, так что ответы могут приходить в любом порядке
+type pooledConn struct {
+	conn   net.Conn
+	nextID uint64
+
+	mu      sync.Mutex
+	pending map[uint64]pendingCall
+
+	writeMu sync.Mutex
+
+	lastUsed  int64 // unix nano, под atomic
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func dialPooledConn(host, port string) (*pooledConn, error) {
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(host, port), connectTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	pc := &pooledConn{
+		conn:    conn,
+		pending: make(map[uint64]pendingCall),
+		closed:  make(chan struct{}),
+	}
+	atomic.StoreInt64(&pc.lastUsed, time.Now().UnixNano())
+	go pc.dispatch()
+	return pc, nil
+}
+
+// dispatch читает кадры [id:8][len:8][payload] и раздаёт каждый ответ ожидающему его
+// вызову по ID — это снимает head-of-line блокировку между параллельными запросами.
+// Запись не удаляется из pending автоматически: запрос может получить несколько кадров
+// подряд (например, progress-конверты TranscribeWithProgress), поэтому отписка — на
+// вызывающем через streamCall.release()
+func (pc *pooledConn) dispatch() {
+	defer pc.closeWithErr(errors.New("соединение с Whisper сервисом разорвано"))
+
+	header := make([]byte, requestHeaderSize)
+	for {
+		if _, err := io.ReadFull(pc.conn, header); err != nil {
+			return
+		}
+		id := binary.BigEndian.Uint64(header[:8])
+		length := binary.BigEndian.Uint64(header[8:])
+
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(pc.conn, payload); err != nil {
+			return
+		}
+
+		pc.mu.Lock()
+		call, ok := pc.pending[id]
+		pc.mu.Unlock()
+
+		if ok {
+			select {
+			case call.response <- payload:
+			default:
+				// вызывающий отстал или уже отписался — не блокируем диспетчер ради одного кадра
+			}
+		}
+	}
+}
+
+func (pc *pooledConn) closeWithErr(err error) {
+	pc.closeOnce.Do(func() {
+		close(pc.closed)
+		pc.conn.Close()
+
+		pc.mu.Lock()
+		defer pc.mu.Unlock()
+		for id, call := range pc.pending {
+			call.errCh <- err
+			delete(pc.pending, id)
+		}
+	})
+}
+
+func (pc *pooledConn) healthy() bool {
+	select {
+	case <-pc.closed:
+		return false
+	default:
+		return true
+	}
+}
+
+// streamCall - хэндл отправленного запроса, по которому можно прочитать один или
+// несколько кадров ответа с тем же ID. Вызывающий обязан вызвать release(), получив
+// финальный кадр, ошибку, либо решив прервать ожидание
+type streamCall struct {
+	pc   *pooledConn
+	id   uint64
+	call pendingCall
+}
+
+// sendFramed присваивает запросу уникальный ID, отправляет его в уже открытое
+// соединение и возвращает streamCall для чтения ответа — одного кадра для обычных
+// запросов или последовательности кадров для потоковых (progress/done)
+func (pc *pooledConn) sendFramed(ctx context.Context, payload []byte) (*streamCall, error) {
+	id := atomic.AddUint64(&pc.nextID, 1)
+	atomic.StoreInt64(&pc.lastUsed, time.Now().UnixNano())
+
+	call := pendingCall{response: make(chan []byte, 8), errCh: make(chan error, 1)}
+	pc.mu.Lock()
+	pc.pending[id] = call
+	pc.mu.Unlock()
+
+	header := make([]byte, requestHeaderSize)
+	binary.BigEndian.PutUint64(header[:8], id)
+	binary.BigEndian.PutUint64(header[8:], uint64(len(payload)))
+
+	pc.writeMu.Lock()
+	pc.conn.SetWriteDeadline(time.Now().Add(connectTimeout))
+	_, werr := pc.conn.Write(append(header, payload...))
+	pc.conn.SetWriteDeadline(time.Time{})
+	pc.writeMu.Unlock()
+
+	sc := &streamCall{pc: pc, id: id, call: call}
+	if werr != nil {
+		sc.release()
+		pc.closeWithErr(werr)
+		return nil, werr
+	}
+	return sc, nil
+}
+
+// next ждёт следующий кадр ответа с тем же ID, ошибку соединения либо отмену контекста
+func (sc *streamCall) next(ctx context.Context) ([]byte, error) {
+	select {
+	case data := <-sc.call.response:
+		return data, nil
+	case err := <-sc.call.errCh:
+		return nil, err
+	case <-sc.pc.closed:
+		return nil, errors.New("соединение закрыто до получения ответа")
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// release отписывает запрос от диспетчера соединения; после вызова дальнейшие кадры
+// с этим ID (которых быть не должно) будут молча отброшены
+func (sc *streamCall) release() {
+	sc.pc.mu.Lock()
+	delete(sc.pc.pending, sc.id)
+	sc.pc.mu.Unlock()
+}
+
+// sendRequest отправляет запрос, ожидающий единственного кадра ответа, и сразу
+// отписывает его от диспетчера
+func (pc *pooledConn) sendRequest(ctx context.Context, payload []byte) ([]byte, error) {
+	sc, err := pc.sendFramed(ctx, payload)
+	if err != nil {
+		return nil, err
+	}
+	defer sc.release()
+	return sc.next(ctx)
+}
+
+// connPool - пул мультиплексированных соединений к Whisper сервису с переподключением
+// оборвавшихся сокетов без влияния на запросы, идущие через соседние соединения
+type connPool struct {
+	host, port string
+	size       int
+
+	mu    sync.Mutex
+	conns []*pooledConn
+	next  int
+}
+
+// newConnPool создаёт пул на size соединений (0 означает GOMAXPROCS) и запускает
+// фоновую проверку здоровья
+func newConnPool(host, port string, size int) *connPool {
+	if size < 1 {
+		size = runtime.GOMAXPROCS(0)
+	}
+	p := &connPool{host: host, port: port, size: size, conns: make([]*pooledConn, size)}
+	go p.healthCheckLoop()
+	return p
+}
+
+// get возвращает рабочее соединение из пула по кругу, переподключая то, что оказалось
+// разорванным или ещё не было открыто
+func (p *connPool) get() (*pooledConn, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i := 0; i < p.size; i++ {
+		idx := (p.next + i) % p.size
+		p.next = (idx + 1) % p.size
+
+		if pc := p.conns[idx]; pc != nil && pc.healthy() {
+			return pc, nil
+		}
+
+		pc, err := dialPooledConn(p.host, p.port)
+		if err != nil {
+			continue
+		}
+		tcpReconnectsTotal.Inc()
+		p.conns[idx] = pc
+		return pc, nil
+	}
+
+	return nil, fmt.Errorf("не удалось получить рабочее соединение из пула к %s", net.JoinHostPort(p.host, p.port))
+}
+
+// healthCheckLoop закрывает и убирает из пула соединения, разорвавшиеся или простаивающие
+// дольше poolIdleTimeout без ожидающих ответа запросов. Сам цикл заново не подключается:
+// новое соединение в освободившийся слот открывает get() при следующем запросе
+func (p *connPool) healthCheckLoop() {
+	ticker := time.NewTicker(poolHealthCheckInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		p.mu.Lock()
+		for i, pc := range p.conns {
+			if pc == nil {
+				continue
+			}
+			idle := time.Since(time.Unix(0, atomic.LoadInt64(&pc.lastUsed)))
+			pc.mu.Lock()
+			inFlight := len(pc.pending)
+			pc.mu.Unlock()
+			if !pc.healthy() || (idle > poolIdleTimeout && inFlight == 0) {
+				pc.closeWithErr(errors.New("соединение закрыто по тайм-ауту простоя"))
+				p.conns[i] = nil
+			}
+		}
+		p.mu.Unlock()
+	}
+}
+
+// closeAll закрывает все соединения пула
+func (p *connPool) closeAll() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, pc := range p.conns {
+		if pc != nil {
+			pc.closeWithErr(errors.New("пул соединений закрыт"))
+			p.conns[i] = nil
+		}
+	}
+}
@@ -0,0 +1,270 @@
+// Package queue реализует очередь фоновых задач транскрипции с персистентным
+// состоянием: долгие запросы можно поставить в очередь и опрашивать по ID, а состояние
+// задач хранится в Store и переживает перезапуск сервера. Задачи, не завершённые к
+// моменту перезапуска, после него заново не запускаются.
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"encoding/json"
+
+	"whisperapi/auth"
+)
+
+// Status - текущее состояние задачи в очереди
+type Status string
+
+const (
+	StatusQueued    Status = "queued"
+	StatusRunning   Status = "running"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+	StatusCanceled  Status = "canceled"
+)
+
+// Job - состояние одной задачи транскрипции
+type Job struct {
+	ID        string          `json:"id"`
+	Status    Status          `json:"status"`
+	Progress  float64         `json:"progress"`
+	Model     string          `json:"model"`
+	Language  string          `json:"language,omitempty"`
+	Task      string          `json:"task"`
+	InputPath string          `json:"input_path"`
+	Result    json.RawMessage `json:"result,omitempty"`
+	Error     string          `json:"error,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+
+	// APIKey и Quotas - ключ и квоты владельца задачи, нужны Handler'у, чтобы списать
+	// аудио-минуты по завершении транскрипции (сам gin.Context запроса, поставившего
+	// задачу в очередь, к этому моменту уже не существует). Хранятся в Store как обычные
+	// поля задачи, но перед возвратом клиенту API должны вычищаться через Redacted() -
+	// APIKey является секретом.
+	APIKey string      `json:"api_key,omitempty"`
+	Quotas auth.Quotas `json:"quotas,omitempty"`
+
+	// Owner - ID принципала, поставившего задачу в очередь (auth.Principal.ID, не сам
+	// ключ). ID задачи (newID) предсказуем, поэтому обработчики API должны сверять Owner
+	// с auth.FromContext(c).ID и возвращать 404 при несовпадении, иначе один ключ сможет
+	// читать и отменять задачи другого.
+	Owner string `json:"owner,omitempty"`
+
+	// AudioRef - ссылка из storage.Backend (абсолютный путь для local, presigned URL для
+	// s3/gcs) на загруженный файл, если он не лежит на диске процесса API. Заполняется
+	// вместо InputPath, когда createJobHandler сохраняет файл через storageBackend.Put -
+	// это то, что позволяет job-очереди работать с S3/GCS бэкендами хранилища так же, как
+	// уже работает transcribeHandler.
+	AudioRef string `json:"audio_ref,omitempty"`
+}
+
+// Redacted возвращает копию задачи без API ключа - используется перед тем, как отдать
+// задачу клиенту через HTTP/SSE, поскольку сам ключ хранится в Job только для того,
+// чтобы воркер мог списать аудио-квоту по завершении транскрипции.
+func (j Job) Redacted() Job {
+	j.APIKey = ""
+	return j
+}
+
+// Store - хранилище состояния задач, переживающее перезапуск процесса
+type Store interface {
+	Save(job Job) error
+	Get(id string) (Job, bool, error)
+	Delete(id string) error
+	List() ([]Job, error)
+}
+
+// Handler выполняет саму транскрипцию задачи. onProgress вызывается по мере
+// поступления сообщений о прогрессе от Whisper и обновляет Job.Progress.
+type Handler func(ctx context.Context, job Job, onProgress func(pct float64)) (json.RawMessage, error)
+
+// Queue - очередь задач с ограниченным пулом воркеров и рассылкой событий подписчикам SSE
+type Queue struct {
+	store   Store
+	handler Handler
+	pending chan string
+
+	mu          sync.Mutex
+	subscribers map[string][]chan Job
+	running     map[string]context.CancelFunc
+}
+
+// New создаёт очередь и запускает пул из workers воркеров, разбирающих задачи по одной
+func New(store Store, handler Handler, workers int) *Queue {
+	if workers < 1 {
+		workers = 1
+	}
+	q := &Queue{
+		store:       store,
+		handler:     handler,
+		pending:     make(chan string, 256),
+		subscribers: make(map[string][]chan Job),
+		running:     make(map[string]context.CancelFunc),
+	}
+	for i := 0; i < workers; i++ {
+		go q.worker()
+	}
+	return q
+}
+
+// Enqueue сохраняет новую задачу в статусе queued и ставит её в очередь на выполнение
+func (q *Queue) Enqueue(job Job) (Job, error) {
+	job.ID = newID()
+	job.Status = StatusQueued
+	job.CreatedAt = time.Now()
+	job.UpdatedAt = job.CreatedAt
+
+	if err := q.store.Save(job); err != nil {
+		return Job{}, err
+	}
+	q.pending <- job.ID
+	return job, nil
+}
+
+// Get возвращает текущее состояние задачи по ID
+func (q *Queue) Get(id string) (Job, bool) {
+	job, ok, err := q.store.Get(id)
+	if err != nil || !ok {
+		return Job{}, false
+	}
+	return job, true
+}
+
+// PendingCount возвращает число задач, ещё не подхваченных воркером
+func (q *Queue) PendingCount() int {
+	return len(q.pending)
+}
+
+// List возвращает все известные задачи
+func (q *Queue) List() []Job {
+	jobs, _ := q.store.List()
+	return jobs
+}
+
+// Cancel помечает ещё не завершённую задачу как отменённую и, если она уже выполняется
+// воркером, отменяет её контекст, чтобы handler прервал работу немедленно
+func (q *Queue) Cancel(id string) error {
+	job, ok, err := q.store.Get(id)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("задача не найдена")
+	}
+	if job.Status != StatusQueued && job.Status != StatusRunning {
+		return nil
+	}
+
+	job.Status = StatusCanceled
+	job.UpdatedAt = time.Now()
+	if err := q.store.Save(job); err != nil {
+		return err
+	}
+	q.broadcast(job)
+
+	q.mu.Lock()
+	cancel, running := q.running[id]
+	q.mu.Unlock()
+	if running {
+		cancel()
+	}
+	return nil
+}
+
+// Subscribe возвращает канал с обновлениями задачи для SSE-подписчика и функцию отписки
+func (q *Queue) Subscribe(id string) (<-chan Job, func()) {
+	ch := make(chan Job, 8)
+
+	q.mu.Lock()
+	q.subscribers[id] = append(q.subscribers[id], ch)
+	q.mu.Unlock()
+
+	cancel := func() {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		subs := q.subscribers[id]
+		for i, c := range subs {
+			if c == ch {
+				q.subscribers[id] = append(subs[:i], subs[i+1:]...)
+				break
+			}
+		}
+		close(ch)
+	}
+	return ch, cancel
+}
+
+func (q *Queue) broadcast(job Job) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, ch := range q.subscribers[job.ID] {
+		select {
+		case ch <- job:
+		default:
+			// медленный подписчик — пропускаем кадр, следующее обновление его догонит
+		}
+	}
+}
+
+func (q *Queue) worker() {
+	for id := range q.pending {
+		job, ok, err := q.store.Get(id)
+		if err != nil || !ok || job.Status != StatusQueued {
+			continue
+		}
+
+		job.Status = StatusRunning
+		job.UpdatedAt = time.Now()
+		q.store.Save(job)
+		q.broadcast(job)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		q.mu.Lock()
+		q.running[id] = cancel
+		q.mu.Unlock()
+
+		result, err := q.handler(ctx, job, func(pct float64) {
+			// Не затираем статус canceled, уже записанный Cancel() в хранилище
+			if current, ok, err := q.store.Get(id); err == nil && ok && current.Status == StatusCanceled {
+				return
+			}
+			job.Progress = pct
+			job.UpdatedAt = time.Now()
+			q.store.Save(job)
+			q.broadcast(job)
+		})
+
+		cancel()
+		q.mu.Lock()
+		delete(q.running, id)
+		q.mu.Unlock()
+
+		// Cancel() мог уже переписать статус задачи в хранилище, пока handler
+		// дорабатывал после отмены контекста — не затираем его результатом.
+		current, ok, storeErr := q.store.Get(id)
+		if storeErr == nil && ok && current.Status == StatusCanceled {
+			continue
+		}
+
+		if err != nil {
+			job.Status = StatusFailed
+			job.Error = err.Error()
+		} else {
+			job.Status = StatusSucceeded
+			job.Progress = 100
+			job.Result = result
+		}
+		job.UpdatedAt = time.Now()
+		q.store.Save(job)
+		q.broadcast(job)
+	}
+}
+
+func newID() string {
+	return fmt.Sprintf("job-%d", time.Now().UnixNano())
+}
@@ -0,0 +1,79 @@
+package queue
+
+import (
+	"encoding/json"
+
+	"github.com/tidwall/buntdb"
+)
+
+// BuntStore - реализация Store поверх BuntDB, хранящая задачи на диске в одном файле
+type BuntStore struct {
+	db *buntdb.DB
+}
+
+// NewBuntStore открывает (или создаёт) файл BuntDB по указанному пути
+func NewBuntStore(path string) (*BuntStore, error) {
+	db, err := buntdb.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &BuntStore{db: db}, nil
+}
+
+func (s *BuntStore) Save(job Job) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *buntdb.Tx) error {
+		_, _, err := tx.Set("job:"+job.ID, string(data), nil)
+		return err
+	})
+}
+
+func (s *BuntStore) Get(id string) (Job, bool, error) {
+	var job Job
+	found := false
+
+	err := s.db.View(func(tx *buntdb.Tx) error {
+		val, err := tx.Get("job:" + id)
+		if err == buntdb.ErrNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		found = true
+		return json.Unmarshal([]byte(val), &job)
+	})
+	return job, found, err
+}
+
+func (s *BuntStore) Delete(id string) error {
+	return s.db.Update(func(tx *buntdb.Tx) error {
+		_, err := tx.Delete("job:" + id)
+		if err == buntdb.ErrNotFound {
+			return nil
+		}
+		return err
+	})
+}
+
+func (s *BuntStore) List() ([]Job, error) {
+	var jobs []Job
+	err := s.db.View(func(tx *buntdb.Tx) error {
+		return tx.Ascend("", func(key, value string) bool {
+			var job Job
+			if json.Unmarshal([]byte(value), &job) == nil {
+				jobs = append(jobs, job)
+			}
+			return true
+		})
+	})
+	return jobs, err
+}
+
+// Close закрывает файл БД
+func (s *BuntStore) Close() error {
+	return s.db.Close()
+}
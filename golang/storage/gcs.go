@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	gcs "cloud.google.com/go/storage"
+)
+
+// gcsRefExpiry - срок жизни подписанного URL, который Put отдаёт Python сервису
+const gcsRefExpiry = time.Hour
+
+// GCSBackend хранит файлы в Google Cloud Storage
+type GCSBackend struct {
+	client *gcs.Client
+	bucket string
+}
+
+// NewGCSBackend создаёт клиента GCS, используя стандартные учётные данные окружения
+func NewGCSBackend(ctx context.Context, bucket string) (*GCSBackend, error) {
+	client, err := gcs.NewClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось создать клиент GCS: %v", err)
+	}
+	return &GCSBackend{client: client, bucket: bucket}, nil
+}
+
+func (b *GCSBackend) Put(ctx context.Context, reader io.Reader) (string, error) {
+	key := fmt.Sprintf("uploads/%d", time.Now().UnixNano())
+	obj := b.client.Bucket(b.bucket).Object(key)
+
+	w := obj.NewWriter(ctx)
+	if _, err := io.Copy(w, reader); err != nil {
+		w.Close()
+		return "", fmt.Errorf("ошибка загрузки в GCS: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		return "", fmt.Errorf("ошибка завершения загрузки в GCS: %v", err)
+	}
+
+	url, err := b.client.Bucket(b.bucket).SignedURL(key, &gcs.SignedURLOptions{
+		Method:  "GET",
+		Expires: time.Now().Add(gcsRefExpiry),
+	})
+	if err != nil {
+		return "", fmt.Errorf("ошибка генерации подписанного URL: %v", err)
+	}
+	return url, nil
+}
+
+func (b *GCSBackend) Open(_ context.Context, ref string) (io.ReadCloser, error) {
+	return httpGetBody(ref)
+}
+
+func (b *GCSBackend) Delete(ctx context.Context, ref string) error {
+	key, err := keyFromSignedURL(ref, b.bucket)
+	if err != nil {
+		return err
+	}
+	return b.client.Bucket(b.bucket).Object(key).Delete(ctx)
+}
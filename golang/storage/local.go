@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// LocalBackend хранит файлы во временной директории на диске процесса API.
+// Годится для однохостовой установки, где API и Python воркер делят файловую систему.
+type LocalBackend struct {
+	Dir string
+}
+
+// NewLocalBackend создаёт (если нужно) директорию dir для загруженных файлов
+func NewLocalBackend(dir string) (*LocalBackend, error) {
+	// Put отдаёт путь внутри dir как ref, поэтому dir приводится к абсолютному пути
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось получить абсолютный путь к директории для загрузок: %v", err)
+	}
+	if err := os.MkdirAll(absDir, 0o755); err != nil {
+		return nil, fmt.Errorf("не удалось создать директорию для загрузок: %v", err)
+	}
+	return &LocalBackend{Dir: absDir}, nil
+}
+
+func (b *LocalBackend) Put(_ context.Context, reader io.Reader) (string, error) {
+	f, err := os.CreateTemp(b.Dir, "whisper-upload-*.tmp")
+	if err != nil {
+		return "", fmt.Errorf("не удалось создать временный файл: %v", err)
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(f, reader); err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("ошибка записи загруженного файла: %v", err)
+	}
+	return f.Name(), nil
+}
+
+func (b *LocalBackend) Open(_ context.Context, ref string) (io.ReadCloser, error) {
+	return os.Open(ref)
+}
+
+func (b *LocalBackend) Delete(_ context.Context, ref string) error {
+	return os.Remove(ref)
+}
@@ -0,0 +1,35 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"strings"
+)
+
+// httpGetBody скачивает presigned URL, по которому объектные бэкенды отдают ref —
+// используется их реализацией Open, где сам ref уже является ссылкой на файл
+func httpGetBody(ref string) (io.ReadCloser, error) {
+	resp, err := http.Get(ref)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка скачивания объекта: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("объект недоступен по ссылке: код %d", resp.StatusCode)
+	}
+	return resp.Body, nil
+}
+
+// keyFromSignedURL восстанавливает ключ объекта из presigned URL, возвращённого Put,
+// чтобы Delete мог найти объект по тому же ref, который получил вызывающий
+func keyFromSignedURL(ref, bucket string) (string, error) {
+	u, err := neturl.Parse(ref)
+	if err != nil {
+		return "", fmt.Errorf("не удалось разобрать ссылку на объект: %v", err)
+	}
+	key := strings.TrimPrefix(u.Path, "/")
+	key = strings.TrimPrefix(key, bucket+"/")
+	return key, nil
+}
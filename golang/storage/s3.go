@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// s3RefExpiry - срок жизни presigned URL, который Put отдаёт Python сервису
+const s3RefExpiry = time.Hour
+
+// S3Backend хранит файлы в S3-совместимом объектном хранилище через minio-go
+type S3Backend struct {
+	client *minio.Client
+	bucket string
+}
+
+// NewS3Backend подключается к эндпоинту S3-совместимого хранилища
+func NewS3Backend(endpoint, accessKey, secretKey, bucket string, useSSL bool) (*S3Backend, error) {
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(accessKey, secretKey, ""),
+		Secure: useSSL,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("не удалось создать клиент S3: %v", err)
+	}
+	return &S3Backend{client: client, bucket: bucket}, nil
+}
+
+func (b *S3Backend) Put(ctx context.Context, reader io.Reader) (string, error) {
+	key := fmt.Sprintf("uploads/%d", time.Now().UnixNano())
+	if _, err := b.client.PutObject(ctx, b.bucket, key, reader, -1, minio.PutObjectOptions{}); err != nil {
+		return "", fmt.Errorf("ошибка загрузки в S3: %v", err)
+	}
+
+	url, err := b.client.PresignedGetObject(ctx, b.bucket, key, s3RefExpiry, nil)
+	if err != nil {
+		return "", fmt.Errorf("ошибка генерации presigned URL: %v", err)
+	}
+	return url.String(), nil
+}
+
+func (b *S3Backend) Open(_ context.Context, ref string) (io.ReadCloser, error) {
+	return httpGetBody(ref)
+}
+
+func (b *S3Backend) Delete(ctx context.Context, ref string) error {
+	key, err := keyFromSignedURL(ref, b.bucket)
+	if err != nil {
+		return err
+	}
+	return b.client.RemoveObject(ctx, b.bucket, key, minio.RemoveObjectOptions{})
+}
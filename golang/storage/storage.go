@@ -0,0 +1,17 @@
+// Package storage абстрагирует место хранения загруженных аудиофайлов, чтобы API и
+// воркеры Whisper могли жить на разных хостах вместо обязательного общего диска.
+package storage
+
+import (
+	"context"
+	"io"
+)
+
+// Backend - хранилище загруженных файлов. Put возвращает ref, по которому Whisper
+// сервис сможет получить файл: абсолютный путь для локального бэкенда, presigned GET
+// URL для объектных хранилищ.
+type Backend interface {
+	Put(ctx context.Context, reader io.Reader) (ref string, err error)
+	Open(ctx context.Context, ref string) (io.ReadCloser, error)
+	Delete(ctx context.Context, ref string) error
+}
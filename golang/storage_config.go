@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+
+	"whisperapi/storage"
+)
+
+// newStorageBackend создаёт storage.Backend согласно STORAGE_BACKEND (local по умолчанию, s3, gcs)
+func newStorageBackend() (storage.Backend, error) {
+	switch backend := getEnv("STORAGE_BACKEND", "local"); backend {
+	case "local":
+		return storage.NewLocalBackend(getEnv("STORAGE_LOCAL_DIR", os.TempDir()))
+
+	case "s3":
+		useSSL, _ := strconv.ParseBool(getEnv("STORAGE_S3_USE_SSL", "true"))
+		return storage.NewS3Backend(
+			getEnv("STORAGE_S3_ENDPOINT", "s3.amazonaws.com"),
+			os.Getenv("STORAGE_S3_ACCESS_KEY"),
+			os.Getenv("STORAGE_S3_SECRET_KEY"),
+			getEnv("STORAGE_BUCKET", ""),
+			useSSL,
+		)
+
+	case "gcs":
+		return storage.NewGCSBackend(context.Background(), getEnv("STORAGE_BUCKET", ""))
+
+	default:
+		return nil, fmt.Errorf("неизвестный STORAGE_BACKEND: %s", backend)
+	}
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// Параметры скользящего окна для буферизации потокового аудио
+const (
+	streamSampleRate     = 16000 // ожидаемая частота дискретизации PCM16 mono от браузера
+	streamWindowSeconds  = 3.0   // длина окна, отправляемого в Whisper
+	streamOverlapSeconds = 0.5   // перекрытие между окнами, чтобы не резать слова на границах
+	streamWindowBacklog  = 2     // сколько окон может накопиться в очереди на отправку
+)
+
+var streamUpgrader = websocket.Upgrader{
+	ReadBufferSize:  4096,
+	WriteBufferSize: 4096,
+	// Сам апгрейдер Origin не проверяет: запросы с источников вне corsAllowedOrigins
+	// отклоняет CORS middleware роутера ещё до обработчика, а ключ проверяет authn.Middleware
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// TranscriptionPartial - частичный либо финальный результат потоковой транскрипции,
+// отправляемый клиенту по WebSocket в виде JSON-кадра.
+type TranscriptionPartial struct {
+	IsPartial bool    `json:"is_partial"`
+	Text      string  `json:"text"`
+	Start     float64 `json:"start"`
+	End       float64 `json:"end"`
+	Language  string  `json:"language"`
+}
+
+// StreamChunkRequest - запрос на транскрипцию одного окна потокового аудио
+type StreamChunkRequest struct {
+	Command   string  `json:"command"`
+	StreamID  string  `json:"stream_id"`
+	AudioData string  `json:"audio_data"`
+	Model     string  `json:"model,omitempty"`
+	Language  *string `json:"language,omitempty"`
+	Task      string  `json:"task,omitempty"`
+	Final     bool    `json:"final"`
+}
+
+// audioWindow - одно накопленное окно PCM/Opus данных, готовое к отправке в Whisper
+type audioWindow struct {
+	data  []byte
+	final bool
+}
+
+// StreamTranscribe принимает канал сырых PCM/Opus кадров от браузера и возвращает канал
+// частичных результатов транскрипции. Входящие кадры буферизуются в скользящие окна
+// ~1-5с с перекрытием 0.5с (это стабилизирует границы слов), каждое окно отправляется в
+// Python-бэкенд новой командой stream_chunk через то же мультиплексированное соединение
+// из connPool, что и остальные запросы, а при закрытии audio канала формируется финальный
+// сегмент. Если бэкенд не успевает обрабатывать окна, самое старое отбрасывается, а не
+// накапливается очередь на отправку.
+func (c *WhisperClient) StreamTranscribe(ctx context.Context, model string, language *string, task string, audio <-chan []byte) (<-chan TranscriptionPartial, error) {
+	streamID := fmt.Sprintf("stream-%d", time.Now().UnixNano())
+	out := make(chan TranscriptionPartial, 16)
+	windows := make(chan audioWindow, streamWindowBacklog)
+
+	atomic.AddInt64(&c.metrics.ActiveStreams, 1)
+	activeStreamsGauge.Inc()
+
+	go c.windowStreamAudio(ctx, audio, windows)
+	go c.sendStreamWindows(ctx, streamID, model, language, task, windows, out)
+
+	return out, nil
+}
+
+// windowStreamAudio группирует сырые кадры в скользящие окна с перекрытием и помечает
+// последнее окно как финальное, когда источник закрывает канал.
+func (c *WhisperClient) windowStreamAudio(ctx context.Context, audio <-chan []byte, windows chan audioWindow) {
+	defer close(windows)
+
+	windowBytes := int(streamWindowSeconds * streamSampleRate * 2) // 16-bit PCM mono
+	overlapBytes := int(streamOverlapSeconds * streamSampleRate * 2)
+
+	buf := make([]byte, 0, windowBytes)
+
+	emit := func(final bool) {
+		if len(buf) == 0 && !final {
+			return
+		}
+		w := audioWindow{data: append([]byte(nil), buf...), final: final}
+		select {
+		case windows <- w:
+		default:
+			// Бэкенд не успевает — отбрасываем самое старое окно и освобождаем место новому
+			select {
+			case <-windows:
+				atomic.AddInt64(&c.metrics.DroppedWindows, 1)
+			default:
+			}
+			select {
+			case windows <- w:
+			default:
+			}
+		}
+		if !final && overlapBytes < len(buf) {
+			buf = append(buf[:0], buf[len(buf)-overlapBytes:]...)
+		} else if !final {
+			buf = buf[:0]
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			emit(true)
+			return
+		case frame, ok := <-audio:
+			if !ok {
+				emit(true)
+				return
+			}
+			buf = append(buf, frame...)
+			if len(buf) >= windowBytes {
+				emit(false)
+			}
+		}
+	}
+}
+
+// sendStreamWindows отправляет каждое окно в Whisper как команду stream_chunk через
+// мультиплексированное соединение из пула и публикует полученные частичные результаты
+// в выходной канал.
+func (c *WhisperClient) sendStreamWindows(ctx context.Context, streamID, model string, language *string, task string, windows <-chan audioWindow, out chan<- TranscriptionPartial) {
+	defer close(out)
+	defer atomic.AddInt64(&c.metrics.ActiveStreams, -1)
+	defer activeStreamsGauge.Dec()
+
+	for w := range windows {
+		request := StreamChunkRequest{
+			Command:   "stream_chunk",
+			StreamID:  streamID,
+			AudioData: base64.StdEncoding.EncodeToString(w.data),
+			Model:     model,
+			Language:  language,
+			Task:      task,
+			Final:     w.final,
+		}
+
+		requestStart := time.Now()
+		responseData, err := c.sendRequestWithContext(ctx, request)
+		if err != nil {
+			log.Printf("поток %s: ошибка отправки окна: %v", streamID, err)
+			return
+		}
+
+		var response TranscriptionResponse
+		if err := json.Unmarshal(responseData, &response); err != nil {
+			log.Printf("поток %s: не удалось разобрать ответ: %v", streamID, err)
+			continue
+		}
+
+		status := "success"
+		if response.Error != "" {
+			status = "error"
+		}
+		recordTranscription(model, task, response.Language, status, time.Since(requestStart), len(w.data))
+
+		if response.Error != "" {
+			log.Printf("поток %s: ошибка бэкенда: %s", streamID, response.Error)
+			continue
+		}
+
+		for _, seg := range response.Segments {
+			out <- TranscriptionPartial{
+				IsPartial: !w.final,
+				Text:      seg.Text,
+				Start:     seg.Start,
+				End:       seg.End,
+				Language:  response.Language,
+			}
+		}
+
+		if w.final {
+			return
+		}
+	}
+}
+
+// streamHandler обслуживает /api/stream: принимает WebSocket соединение от браузера,
+// перенаправляет сырые аудиокадры в StreamTranscribe и транслирует обратно JSON-кадры
+// с частичными и финальным результатами.
+func streamHandler(c *gin.Context) {
+	ws, err := streamUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		log.Printf("не удалось установить WebSocket соединение: %v", err)
+		return
+	}
+	defer ws.Close()
+
+	model := c.DefaultQuery("model", "base")
+	task := c.DefaultQuery("task", "transcribe")
+	var language *string
+	if langValue := c.Query("language"); langValue != "" {
+		language = &langValue
+	}
+
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	defer cancel()
+
+	audio := make(chan []byte, streamWindowBacklog)
+	partials, err := whisperClient.StreamTranscribe(ctx, model, language, task, audio)
+	if err != nil {
+		ws.WriteJSON(gin.H{"error": err.Error()})
+		return
+	}
+
+	go func() {
+		defer close(audio)
+		for {
+			msgType, data, err := ws.ReadMessage()
+			if err != nil {
+				return
+			}
+			if msgType != websocket.BinaryMessage {
+				continue
+			}
+			select {
+			case audio <- data:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var finalEnd float64
+	for partial := range partials {
+		if !partial.IsPartial {
+			finalEnd = partial.End
+		}
+		if err := ws.WriteJSON(partial); err != nil {
+			cancel()
+			break
+		}
+	}
+
+	// Списываем аудио-минуты с суточной квоты ключа по концу последнего финального
+	// сегмента - та же оценка длительности, что в transcribeHandler и runTranscriptionJob
+	if finalEnd > 0 {
+		chargeAudioQuota(c, finalEnd)
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	awsv2 "github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	awss3 "github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/gin-gonic/gin"
+	"github.com/tus/tusd/v2/pkg/filestore"
+	"github.com/tus/tusd/v2/pkg/handler"
+	"github.com/tus/tusd/v2/pkg/s3store"
+)
+
+// tusUploadsDir - локальная директория для незавершённых TUS загрузок, используется при
+// любом STORAGE_BACKEND, кроме s3 (в том числе при gcs: TUS загрузки тогда остаются на
+// локальном диске). Для s3 чанки пишутся прямо в бакет через s3store, и
+// resolveTusUploadPath вместо пути отдаёт presigned GET URL через tusS3Presign.
+var tusUploadsDir string
+
+// tusS3Client и tusS3Presign - клиент и presign-клиент AWS SDK v2 для бэкенда s3; nil,
+// если TUS поднят на локальном хранилище. tusS3Bucket - бакет, которым пользуется s3store.
+var (
+	tusS3Client  *awss3.Client
+	tusS3Presign *awss3.PresignClient
+	tusS3Bucket  string
+)
+
+// newTusHandler поднимает обработчик резюмируемых TUS загрузок на базе того же
+// STORAGE_BACKEND, что и storageBackend. TUS требует произвольной записи по смещению
+// и блокировок между чанками, которых нет в storage.Backend, поэтому используется
+// собственное хранилище tusd, а не сам объект Backend: для s3 - s3store в бакете
+// STORAGE_BUCKET, для всех остальных значений (включая gcs) - filestore в локальной
+// директории STORAGE_LOCAL_DIR; бакет GCS для TUS загрузок не используется.
+func newTusHandler() (*handler.Handler, error) {
+	composer := handler.NewStoreComposer()
+
+	switch getEnv("STORAGE_BACKEND", "local") {
+	case "s3":
+		cfg, err := awsconfig.LoadDefaultConfig(context.Background(),
+			awsconfig.WithRegion(getEnv("STORAGE_S3_REGION", "us-east-1")))
+		if err != nil {
+			return nil, fmt.Errorf("не удалось создать AWS сессию для TUS: %v", err)
+		}
+		client := awss3.NewFromConfig(cfg, func(o *awss3.Options) {
+			o.UsePathStyle = true
+			if endpoint := getEnv("STORAGE_S3_ENDPOINT", ""); endpoint != "" {
+				o.BaseEndpoint = awsv2.String(endpoint)
+			}
+		})
+		tusS3Bucket = getEnv("STORAGE_BUCKET", "")
+		store := s3store.New(tusS3Bucket, client)
+		store.UseIn(composer)
+
+		tusS3Client = client
+		tusS3Presign = awss3.NewPresignClient(client)
+
+	default:
+		tusUploadsDir = getEnv("STORAGE_LOCAL_DIR", os.TempDir())
+		if err := os.MkdirAll(tusUploadsDir, 0o755); err != nil {
+			return nil, fmt.Errorf("не удалось создать директорию для TUS загрузок: %v", err)
+		}
+		store := filestore.FileStore{Path: tusUploadsDir}
+		store.UseIn(composer)
+	}
+
+	return handler.NewHandler(handler.Config{
+		BasePath:                  "/api/uploads/",
+		StoreComposer:             composer,
+		NotifyCompleteUploads:     true,
+		PreFinishResponseCallback: validateFinishedUpload,
+	})
+}
+
+// validateFinishedUpload - pre-finish хук TUS: прогоняет завершённую загрузку через
+// ffprobe и отклоняет её, если это не аудио/видео с положительной длительностью. ffprobe
+// умеет читать как локальный путь, так и presigned URL, так что хук работает одинаково
+// для обоих бэкендов хранилища.
+func validateFinishedUpload(hook handler.HookEvent) (handler.HTTPResponse, error) {
+	ref, _, err := resolveTusUploadPath(hook.Upload.ID)
+	if err != nil {
+		return handler.HTTPResponse{}, err
+	}
+
+	if err := probeAudioDuration(ref); err != nil {
+		return handler.HTTPResponse{StatusCode: http.StatusUnprocessableEntity}, err
+	}
+
+	return handler.HTTPResponse{}, nil
+}
+
+// probeAudioDuration запускает ffprobe над файлом или URL и отклоняет всё, что не
+// распознаётся как медиаконтейнер с положительной длительностью
+func probeAudioDuration(ref string) error {
+	out, err := exec.Command("ffprobe", "-v", "error",
+		"-show_entries", "format=duration,format_name",
+		"-of", "default=noprint_wrappers=1", ref).Output()
+	if err != nil {
+		return fmt.Errorf("ffprobe не смог обработать файл: %v", err)
+	}
+
+	for _, line := range strings.Split(string(out), "\n") {
+		if !strings.HasPrefix(line, "duration=") {
+			continue
+		}
+		duration, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimPrefix(line, "duration=")), 64)
+		if err == nil && duration > 0 {
+			return nil
+		}
+	}
+	return errors.New("не удалось определить длительность загруженного файла")
+}
+
+// tusUploadIDPattern - допустимые символы части ID TUS загрузки, используемой как ключ
+// хранилища (локальный путь либо ключ объекта в S3); не содержит "/" и "..", так как
+// из неё строится либо путь внутри tusUploadsDir, либо ключ объекта S3.
+var tusUploadIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// resolveTusUploadPath возвращает ссылку на завершённую TUS загрузку по её ID: абсолютный
+// локальный путь для STORAGE_BACKEND=local (isLocal=true) либо presigned GET URL для
+// STORAGE_BACKEND=s3 (isLocal=false) - вызывающий код кладёт результат в queue.Job.InputPath
+// или queue.Job.AudioRef соответственно, как и storage.Backend.Put. ID проверяется по
+// шаблону и должен указывать на завершённую (Offset == Size) загрузку - иначе это открытый
+// путь к чтению/удалению произвольного файла (local) или доступу к чужому объекту (s3).
+func resolveTusUploadPath(uploadID string) (ref string, isLocal bool, err error) {
+	switch {
+	case tusUploadsDir != "":
+		path, err := resolveLocalTusUpload(uploadID)
+		return path, true, err
+	case tusS3Presign != nil:
+		url, err := resolveS3TusUpload(uploadID)
+		return url, false, err
+	default:
+		return "", false, errors.New("хранилище TUS загрузок не настроено")
+	}
+}
+
+func resolveLocalTusUpload(uploadID string) (string, error) {
+	if !tusUploadIDPattern.MatchString(uploadID) {
+		return "", fmt.Errorf("некорректный upload_id: %s", uploadID)
+	}
+
+	infoData, err := os.ReadFile(filepath.Join(tusUploadsDir, uploadID+".info"))
+	if err != nil {
+		return "", fmt.Errorf("загрузка %s не найдена: %v", uploadID, err)
+	}
+	var info struct {
+		Offset int64
+		Size   int64
+	}
+	if err := json.Unmarshal(infoData, &info); err != nil {
+		return "", fmt.Errorf("не удалось прочитать метаданные загрузки %s: %v", uploadID, err)
+	}
+	if info.Size <= 0 || info.Offset != info.Size {
+		return "", fmt.Errorf("загрузка %s ещё не завершена", uploadID)
+	}
+
+	path := filepath.Join(tusUploadsDir, uploadID)
+	if _, err := os.Stat(path); err != nil {
+		return "", fmt.Errorf("загрузка %s не найдена: %v", uploadID, err)
+	}
+	return path, nil
+}
+
+// resolveS3TusUpload возвращает presigned GET URL на завершённую TUS загрузку в S3.
+// objectID - ключ объекта в бакете, первая часть ID до "+" (вторая часть - ID AWS
+// multipart upload, нужна только самому s3store для поиска загрузки и здесь не
+// используется); .info объект с метаданными лежит под тем же ключом с суффиксом ".info",
+// как и у локального бэкенда.
+func resolveS3TusUpload(uploadID string) (string, error) {
+	objectID, _, ok := strings.Cut(uploadID, "+")
+	if !ok || !tusUploadIDPattern.MatchString(objectID) {
+		return "", fmt.Errorf("некорректный upload_id: %s", uploadID)
+	}
+
+	ctx := context.Background()
+	infoObj, err := tusS3Client.GetObject(ctx, &awss3.GetObjectInput{
+		Bucket: awsv2.String(tusS3Bucket),
+		Key:    awsv2.String(objectID + ".info"),
+	})
+	if err != nil {
+		return "", fmt.Errorf("загрузка %s не найдена: %v", uploadID, err)
+	}
+	defer infoObj.Body.Close()
+
+	var info struct {
+		Offset int64
+		Size   int64
+	}
+	if err := json.NewDecoder(infoObj.Body).Decode(&info); err != nil {
+		return "", fmt.Errorf("не удалось прочитать метаданные загрузки %s: %v", uploadID, err)
+	}
+	if info.Size <= 0 || info.Offset != info.Size {
+		return "", fmt.Errorf("загрузка %s ещё не завершена", uploadID)
+	}
+
+	presigned, err := tusS3Presign.PresignGetObject(ctx, &awss3.GetObjectInput{
+		Bucket: awsv2.String(tusS3Bucket),
+		Key:    awsv2.String(objectID),
+	})
+	if err != nil {
+		return "", fmt.Errorf("не удалось подписать ссылку на загрузку %s: %v", uploadID, err)
+	}
+	return presigned.URL, nil
+}
+
+// registerTusRoutes монтирует обработчик TUS на /api/uploads
+func registerTusRoutes(router *gin.Engine, tusHandler *handler.Handler) {
+	wrapped := gin.WrapH(http.StripPrefix("/api/uploads", tusHandler))
+	router.Any("/api/uploads", wrapped)
+	router.Any("/api/uploads/*any", wrapped)
+}
@@ -3,29 +3,26 @@ package main
 import (
 	"context"
 	"encoding/base64"
-	"encoding/binary"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"log"
 	"net"
 	"net/http"
 	"os"
 	"path/filepath"
-	"sync"
+	"strconv"
 	"sync/atomic"
 	"time"
 )
 
 // WhisperClient - клиент для взаимодействия с Python сервисом
 type WhisperClient struct {
-	Host     string
-	Port     string
-	conn     net.Conn
-	connLock sync.Mutex
-	metrics  Metrics
-	client   *http.Client
+	Host    string
+	Port    string
+	pool    *connPool
+	metrics Metrics
+	client  *http.Client
 }
 
 // Metrics - метрики клиента
@@ -33,20 +30,20 @@ type Metrics struct {
 	RequestsTotal    int64
 	ErrorsTotal      int64
 	ProcessingTimeMs int64
+	ActiveStreams    int64 // количество открытых сейчас /api/stream соединений
+	DroppedWindows   int64 // сколько окон потокового аудио отброшено из-за backpressure
 }
 
 // Константы для работы с соединением
 const (
-	headerSize     = 8
-	maxRetries     = 3
-	retryTimeout   = 2 * time.Second
 	connectTimeout = 5 * time.Second
 )
 
 // Структуры для запросов и ответов
 type FileTranscriptionRequest struct {
 	Command   string  `json:"command"`
-	AudioPath string  `json:"audio_path"`
+	AudioPath string  `json:"audio_path,omitempty"`
+	AudioURL  string  `json:"audio_url,omitempty"` // ссылка из storage.Backend: путь либо presigned URL
 	Model     string  `json:"model,omitempty"`
 	Language  *string `json:"language,omitempty"`
 	Task      string  `json:"task,omitempty"`
@@ -100,53 +97,21 @@ func NewWhisperClient(host, port string) *WhisperClient {
 			ResponseHeaderTimeout: 30 * time.Second,
 		},
 	}
+	poolSize := 0 // 0 => newConnPool выберет GOMAXPROCS
+	if raw := os.Getenv("WHISPER_POOL_SIZE"); raw != "" {
+		if n, err := strconv.Atoi(raw); err == nil && n > 0 {
+			poolSize = n
+		}
+	}
+
 	return &WhisperClient{
 		Host:   host,
 		Port:   port,
+		pool:   newConnPool(host, port, poolSize),
 		client: client,
 	}
 }
 
-// ensureConnection устанавливает соединение с сервером, если оно отсутствует
-func (c *WhisperClient) ensureConnection() error {
-	c.connLock.Lock()
-	defer c.connLock.Unlock()
-
-	if c.conn != nil {
-		return nil
-	}
-
-	var err error
-	for i := 0; i < maxRetries; i++ {
-		addr := net.JoinHostPort(c.Host, c.Port)
-		dialer := &net.Dialer{
-			Timeout: connectTimeout,
-		}
-		c.conn, err = dialer.Dial("tcp", addr)
-		if err == nil {
-			return nil
-		}
-
-		log.Printf("Не удалось установить соединение (попытка %d/%d): %v", i+1, maxRetries, err)
-		if i < maxRetries-1 {
-			time.Sleep(retryTimeout)
-		}
-	}
-
-	return errors.New("не удалось установить соединение с Whisper сервисом")
-}
-
-// closeConnection закрывает текущее соединение
-func (c *WhisperClient) closeConnection() {
-	c.connLock.Lock()
-	defer c.connLock.Unlock()
-
-	if c.conn != nil {
-		c.conn.Close()
-		c.conn = nil
-	}
-}
-
 // handleResponse обрабатывает ответ от сервера
 func (c *WhisperClient) handleResponse(responseData []byte) (*TranscriptionResponse, error) {
 	var response TranscriptionResponse
@@ -163,62 +128,12 @@ func (c *WhisperClient) handleResponse(responseData []byte) (*TranscriptionRespo
 	return &response, nil
 }
 
-// sendRequest отправляет запрос и получает ответ от сервера
+// sendRequest отправляет запрос и получает ответ от сервера через пул соединений,
+// используя тот же таймаут, что и Transcribe, на случай долгой обработки на стороне Python
 func (c *WhisperClient) sendRequest(requestData interface{}) ([]byte, error) {
-	startTime := time.Now()
-	atomic.AddInt64(&c.metrics.RequestsTotal, 1)
-
-	defer func() {
-		duration := time.Since(startTime)
-		atomic.AddInt64(&c.metrics.ProcessingTimeMs, duration.Milliseconds())
-		c.logRequest("sendRequest", duration, nil)
-	}()
-
-	// Убеждаемся, что соединение установлено
-	if err := c.ensureConnection(); err != nil {
-		return nil, err
-	}
-
-	// Сериализуем запрос в JSON
-	requestJSON, err := json.Marshal(requestData)
-	if err != nil {
-		return nil, err
-	}
-
-	// Подготавливаем заголовок с длиной сообщения
-	requestLen := len(requestJSON)
-	header := make([]byte, headerSize)
-	binary.BigEndian.PutUint64(header, uint64(requestLen))
-
-	// Устанавливаем таймаут для записи
-	c.conn.SetWriteDeadline(time.Now().Add(connectTimeout))
-	if _, err := c.conn.Write(header); err != nil {
-		c.closeConnection()
-		return nil, err
-	}
-	if _, err := c.conn.Write(requestJSON); err != nil {
-		c.closeConnection()
-		return nil, err
-	}
-	c.conn.SetWriteDeadline(time.Time{})
-
-	// Получаем ответ
-	headerBuf := make([]byte, headerSize)
-	c.conn.SetReadDeadline(time.Now().Add(connectTimeout))
-	if _, err := io.ReadFull(c.conn, headerBuf); err != nil {
-		c.closeConnection()
-		return nil, err
-	}
-
-	responseLen := binary.BigEndian.Uint64(headerBuf)
-	responseBuf := make([]byte, responseLen)
-	if _, err := io.ReadFull(c.conn, responseBuf); err != nil {
-		c.closeConnection()
-		return nil, err
-	}
-	c.conn.SetReadDeadline(time.Time{})
-
-	return responseBuf, nil
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+	return c.sendRequestWithContext(ctx, requestData)
 }
 
 // logRequest логирует информацию о запросе
@@ -268,58 +183,170 @@ func (c *WhisperClient) Transcribe(audioPath string, model string, language *str
 	return c.handleResponse(responseData)
 }
 
-// sendRequestWithContext отправляет запрос с поддержкой контекста
-func (c *WhisperClient) sendRequestWithContext(_ context.Context, request interface{}) ([]byte, error) {
-	startTime := time.Now()
-	atomic.AddInt64(&c.metrics.RequestsTotal, 1)
+// TranscribeRef выполняет транскрипцию файла по ссылке из storage.Backend — абсолютному
+// пути для локального хранилища или presigned URL для S3/GCS. В отличие от Transcribe
+// не требует, чтобы файл был виден в файловой системе процесса Go: по audio_url его
+// читает сам Python сервис, что позволяет API и Whisper воркерам жить на разных хостах.
+func (c *WhisperClient) TranscribeRef(ref, model string, language *string, task string) (*TranscriptionResponse, error) {
+	if language != nil && *language == "" {
+		language = nil
+	}
 
-	defer func() {
-		duration := time.Since(startTime)
-		atomic.AddInt64(&c.metrics.ProcessingTimeMs, duration.Milliseconds())
-		c.logRequest("sendRequest", duration, nil)
-	}()
+	request := FileTranscriptionRequest{
+		Command:  "transcribe",
+		AudioURL: ref,
+		Model:    model,
+		Language: language,
+		Task:     task,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
 
-	// Сериализуем запрос в JSON
+	responseData, err := c.sendRequestWithContext(ctx, request)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при отправке запроса: %v", err)
+	}
+
+	return c.handleResponse(responseData)
+}
+
+// progressEnvelope - кадр, которым Python сервис сопровождает длительную транскрипцию:
+// либо промежуточное сообщение о прогрессе, либо финальный результат
+type progressEnvelope struct {
+	Status   string                 `json:"status"` // "progress" | "done"
+	Progress float64                `json:"progress,omitempty"`
+	Segment  *Segment               `json:"segment,omitempty"`
+	Result   *TranscriptionResponse `json:"result,omitempty"`
+	Error    string                 `json:"error,omitempty"`
+}
+
+// TranscribeWithProgress выполняет транскрипцию так же, как Transcribe, но вместо
+// одного ответа читает с мультиплексированного соединения из пула последовательность
+// кадров с тем же ID запроса: сообщения со статусом "progress" вызывают onProgress,
+// а кадр со статусом "done" несёт итоговый результат. Используется очередью задач,
+// чтобы отражать прогресс долгих транскрипций в реальном времени, не занимая отдельное
+// TCP соединение на всё время транскрипции.
+func (c *WhisperClient) TranscribeWithProgress(ctx context.Context, audioPath, model string, language *string, task string, onProgress func(float64)) (*TranscriptionResponse, error) {
+	absPath, err := filepath.Abs(audioPath)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось получить абсолютный путь к файлу: %v", err)
+	}
+	if _, err := os.Stat(absPath); os.IsNotExist(err) {
+		return nil, fmt.Errorf("файл не существует: %s", absPath)
+	}
+	if language != nil && *language == "" {
+		language = nil
+	}
+
+	request := FileTranscriptionRequest{
+		Command:   "transcribe_progress",
+		AudioPath: absPath,
+		Model:     model,
+		Language:  language,
+		Task:      task,
+	}
 	requestJSON, err := json.Marshal(request)
 	if err != nil {
 		return nil, fmt.Errorf("ошибка при сериализации запроса: %v", err)
 	}
 
-	// Устанавливаем соединение
-	conn, err := net.DialTimeout("tcp", net.JoinHostPort(c.Host, c.Port), 30*time.Second)
+	return c.streamProgress(ctx, requestJSON, onProgress)
+}
+
+// TranscribeRefWithProgress выполняет транскрипцию так же, как TranscribeWithProgress,
+// но по ссылке из storage.Backend вместо локального пути (audio_url, как в TranscribeRef) -
+// используется очередью задач, когда файл загружен через S3/GCS бэкенд хранилища и
+// недоступен на диске процесса API.
+func (c *WhisperClient) TranscribeRefWithProgress(ctx context.Context, ref, model string, language *string, task string, onProgress func(float64)) (*TranscriptionResponse, error) {
+	if language != nil && *language == "" {
+		language = nil
+	}
+
+	request := FileTranscriptionRequest{
+		Command:  "transcribe_progress",
+		AudioURL: ref,
+		Model:    model,
+		Language: language,
+		Task:     task,
+	}
+	requestJSON, err := json.Marshal(request)
 	if err != nil {
-		return nil, fmt.Errorf("ошибка при установке соединения: %v", err)
+		return nil, fmt.Errorf("ошибка при сериализации запроса: %v", err)
 	}
-	defer conn.Close()
 
-	// Устанавливаем таймауты
-	conn.SetDeadline(time.Now().Add(30 * time.Minute))
+	return c.streamProgress(ctx, requestJSON, onProgress)
+}
+
+// streamProgress отправляет уже сериализованный запрос transcribe_progress через
+// мультиплексированное соединение из пула и читает последовательность кадров с тем же
+// ID запроса до кадра "done", используется и TranscribeWithProgress, и TranscribeRefWithProgress.
+func (c *WhisperClient) streamProgress(ctx context.Context, requestJSON []byte, onProgress func(float64)) (*TranscriptionResponse, error) {
+	pc, err := c.pool.get()
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении соединения из пула: %v", err)
+	}
 
-	// Отправляем длину сообщения
-	header := make([]byte, 8)
-	binary.BigEndian.PutUint64(header, uint64(len(requestJSON)))
-	if _, err := conn.Write(header); err != nil {
-		return nil, fmt.Errorf("ошибка при отправке заголовка: %v", err)
+	sc, err := pc.sendFramed(ctx, requestJSON)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при отправке запроса: %v", err)
 	}
+	defer sc.release()
+
+	for {
+		frame, err := sc.next(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		var envelope progressEnvelope
+		if err := json.Unmarshal(frame, &envelope); err != nil {
+			return nil, fmt.Errorf("не удалось разобрать сообщение о прогрессе: %v", err)
+		}
+		if envelope.Error != "" {
+			return nil, errors.New(envelope.Error)
+		}
 
-	// Отправляем данные
-	if _, err := conn.Write(requestJSON); err != nil {
-		return nil, fmt.Errorf("ошибка при отправке данных: %v", err)
+		switch envelope.Status {
+		case "progress":
+			if onProgress != nil {
+				onProgress(envelope.Progress)
+			}
+		case "done":
+			if envelope.Result == nil {
+				return nil, errors.New("сообщение done не содержит результата")
+			}
+			return envelope.Result, nil
+		default:
+			return nil, fmt.Errorf("неизвестный статус сообщения: %s", envelope.Status)
+		}
 	}
+}
+
+// sendRequestWithContext сериализует запрос и отправляет его через мультиплексированное
+// соединение из пула: запрос получает свой ID и ждёт только собственный ответ, не
+// блокируясь на других вызовах, идущих через то же самое TCP соединение
+func (c *WhisperClient) sendRequestWithContext(ctx context.Context, request interface{}) ([]byte, error) {
+	startTime := time.Now()
+	atomic.AddInt64(&c.metrics.RequestsTotal, 1)
+
+	defer func() {
+		duration := time.Since(startTime)
+		atomic.AddInt64(&c.metrics.ProcessingTimeMs, duration.Milliseconds())
+		c.logRequest("sendRequest", duration, nil)
+	}()
 
-	// Читаем ответ
-	headerBuf := make([]byte, 8)
-	if _, err := io.ReadFull(conn, headerBuf); err != nil {
-		return nil, fmt.Errorf("ошибка при чтении заголовка ответа: %v", err)
+	requestJSON, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при сериализации запроса: %v", err)
 	}
 
-	responseLen := binary.BigEndian.Uint64(headerBuf)
-	responseBuf := make([]byte, responseLen)
-	if _, err := io.ReadFull(conn, responseBuf); err != nil {
-		return nil, fmt.Errorf("ошибка при чтении ответа: %v", err)
+	pc, err := c.pool.get()
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении соединения из пула: %v", err)
 	}
 
-	return responseBuf, nil
+	return pc.sendRequest(ctx, requestJSON)
 }
 
 // TranscribeWithContext выполняет транскрипцию с поддержкой контекста
@@ -350,7 +377,19 @@ func (c *WhisperClient) TranscribeData(audioData []byte, model string, language
 		Task:      task,
 	}
 
+	requestStart := time.Now()
 	responseData, err := c.sendRequest(request)
+
+	status := "success"
+	if err != nil {
+		status = "error"
+	}
+	languageLabel := ""
+	if language != nil {
+		languageLabel = *language
+	}
+	recordTranscription(model, task, languageLabel, status, time.Since(requestStart), len(audioData))
+
 	if err != nil {
 		return nil, err
 	}
@@ -396,7 +435,7 @@ func (c *WhisperClient) GetMetrics() Metrics {
 	return c.metrics
 }
 
-// Close закрывает соединение с сервером
+// Close закрывает все соединения в пуле
 func (c *WhisperClient) Close() {
-	c.closeConnection()
+	c.pool.closeAll()
 }